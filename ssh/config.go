@@ -0,0 +1,29 @@
+package ssh
+
+//SessionConfig configures a MultiCommandSession.
+type SessionConfig struct {
+	//Shell is the remote shell to start, e.g. "/bin/bash". Defaults to defaultShell.
+	Shell string
+	//Term is the pty terminal type requested from the remote, e.g. "xterm".
+	Term string
+	//Rows and Columns size the remote pty.
+	Rows    int
+	Columns int
+	//EnvVariables are set on the remote session before the shell starts.
+	EnvVariables map[string]string
+	//Recorder, when set, captures every command sent and every chunk of
+	//output received for audit and replay.
+	Recorder SessionRecorder
+}
+
+func (c *SessionConfig) applyDefault() {
+	if c.Term == "" {
+		c.Term = "xterm"
+	}
+	if c.Rows == 0 {
+		c.Rows = 40
+	}
+	if c.Columns == 0 {
+		c.Columns = 80
+	}
+}
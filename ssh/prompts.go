@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//PromptResponder matches a pattern appearing in command output and supplies
+//the response to write back through stdin, e.g. for sudo password prompts or
+//SSH host-key confirmations. Once, when set, answers the prompt only once
+//per RunWithPrompts call, even if the pattern keeps matching the tail of the
+//output.
+type PromptResponder struct {
+	Pattern  *regexp.Regexp
+	Response string
+	Once     bool
+
+	answered bool
+}
+
+var (
+	//SudoPasswordPrompt matches the standard sudo password prompt.
+	SudoPasswordPrompt = regexp.MustCompile(`\[sudo\] password for [^:]+:\s*$`)
+	//HostKeyConfirmPrompt matches the SSH unknown-host yes/no confirmation prompt.
+	HostKeyConfirmPrompt = regexp.MustCompile(`(?i)are you sure you want to continue connecting \(yes/no.*\)\?\s*$`)
+	//PasswordPrompt matches a generic password prompt.
+	PasswordPrompt = regexp.MustCompile(`(?i)assword:\s*$`)
+)
+
+//SudoResponders returns a responder that answers a sudo password prompt once
+//with password.
+func SudoResponders(password string) []PromptResponder {
+	return []PromptResponder{
+		{Pattern: SudoPasswordPrompt, Response: password, Once: true},
+	}
+}
+
+//HostKeyResponders returns a responder that auto-accepts SSH host-key
+//confirmation prompts.
+func HostKeyResponders() []PromptResponder {
+	return []PromptResponder{
+		{Pattern: HostKeyConfirmPrompt, Response: "yes"},
+	}
+}
+
+//RunWithPrompts runs command and, as output streams in, answers any matching
+//responder with its configured response, e.g. to script a
+//"sudo su" -> "sh /usr/bin/myscript.sh" flow without hand-rolling a state
+//machine on top of Run. On timeout it interrupts the remote command the
+//same way RunContext does, rather than merely abandoning the session.
+func (s *multiCommandSession) RunWithPrompts(command string, timeoutMs int, responders []PromptResponder) (string, error) {
+	if timeoutMs == 0 {
+		timeoutMs = defautTimeoutMs
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+	return s.RunPromptsContext(ctx, command, responders)
+}
+
+//RunPromptsContext is like RunWithPrompts but takes caller-controlled
+//cancellation: when ctx is done, a hung remote command is interrupted
+//(SIGINT plus a literal ^C) rather than merely abandoned.
+func (s *multiCommandSession) RunPromptsContext(ctx context.Context, command string, responders []PromptResponder) (string, error) {
+	s.drainStdout()
+	if _, err := s.writeInput([]byte(command + "\n")); err != nil {
+		return "", fmt.Errorf("Failed to execute command: %v, err: %v", command, err)
+	}
+	for i := range responders {
+		responders[i].answered = false
+	}
+	//outBuilder/errBuilder accumulate the full response (amortized
+	//O(1) append), the same as readResponse; outTail/errTail mirror only the
+	//trailing terminatorWindow bytes so responder and terminator matching
+	//re-scans a bounded window instead of the ever-growing accumulation.
+	var outBuilder, errBuilder strings.Builder
+	var outTail, errTail string
+outer:
+	for {
+		//Take, not String+Reset: a separate read-then-reset leaves a window
+		//where a concurrent drain() write lands after the read and is wiped
+		//by the reset, silently losing output.
+		gotData := false
+		if chunk := s.stdOutBuf.Take(); len(chunk) > 0 {
+			gotData = true
+			outBuilder.Write(chunk)
+			outTail = tailWindow(outTail+string(chunk), terminatorWindow)
+		}
+		if chunk := s.stdErrBuf.Take(); len(chunk) > 0 {
+			gotData = true
+			errBuilder.Write(chunk)
+			errTail = tailWindow(errTail+string(chunk), terminatorWindow)
+		}
+		//only match responders/terminators once this pass actually consumed
+		//new bytes: checking unconditionally would fire against still-empty
+		//outTail/errTail before the remote ever wrote anything, since a
+		//terminator ending in "$" degenerates into a vacuous HasSuffix(x, "")
+		//match.
+		if gotData {
+			for i := range responders {
+				responder := &responders[i]
+				if responder.Once && responder.answered {
+					continue
+				}
+				if responder.Pattern.MatchString(outTail) {
+					if _, err := s.writeInput([]byte(responder.Response + "\n")); err != nil {
+						return outBuilder.String(), err
+					}
+					responder.answered = true
+					//clear only the re-scanned tail, not the accumulated
+					//result: otherwise the same answered prompt text could
+					//keep re-matching, and wiping out would silently drop
+					//every real output line seen before it.
+					outTail = ""
+					continue outer
+				}
+			}
+			if hasTerminator(outTail, s.shellPrompt+"$") || s.matchesPrompt(outTail) {
+				return s.trimPrompt(outBuilder.String()), nil
+			}
+			if errTail != "" && (hasTerminator(errTail, s.shellPrompt+"$") || s.matchesPrompt(errTail)) {
+				return s.trimPrompt(outBuilder.String()), errors.New(errBuilder.String())
+			}
+		}
+		select {
+		case <-s.stdOutNotify:
+			continue
+		case <-s.stdErrNotify:
+			continue
+		case <-ctx.Done():
+			//the remote command is still running but we've given up waiting on
+			//it: actually interrupt it instead of just abandoning the session
+			//with output still draining into buffers.
+			s.session.Signal(ssh.SIGINT)
+			s.writeInput([]byte{0x03})
+			if errBuilder.Len() > 0 {
+				return s.trimPrompt(outBuilder.String()), errors.New(errBuilder.String())
+			}
+			return s.trimPrompt(outBuilder.String()), nil
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ssh
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+//scriptedInput is an io.WriteCloser stand-in for the remote shell's stdin:
+//each Write (the initial command, or a responder's reply) triggers pushing
+//the next scripted chunk of output into the session's buffers, so
+//RunPromptsContext can be driven without a live SSH connection.
+type scriptedInput struct {
+	session *multiCommandSession
+	replies [][]byte
+	step    int
+	writes  []string
+}
+
+func (w *scriptedInput) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	if w.step < len(w.replies) {
+		reply := w.replies[w.step]
+		w.step++
+		w.session.stdOutBuf.Write(reply)
+		signalOutput(w.session.stdOutNotify)
+	}
+	return len(p), nil
+}
+
+func (w *scriptedInput) Close() error { return nil }
+
+func newScriptedSession(shellPrompt string, replies ...string) (*multiCommandSession, *scriptedInput) {
+	session := &multiCommandSession{
+		stdOutBuf:    newRingBuffer(ringBufferCapacity),
+		stdErrBuf:    newRingBuffer(ringBufferCapacity),
+		stdOutNotify: make(chan struct{}, 1),
+		stdErrNotify: make(chan struct{}, 1),
+		shellPrompt:  shellPrompt,
+	}
+	byteReplies := make([][]byte, len(replies))
+	for i, reply := range replies {
+		byteReplies[i] = []byte(reply)
+	}
+	input := &scriptedInput{session: session, replies: byteReplies}
+	session.stdInput = input
+	return session, input
+}
+
+func TestRunPromptsContextPreservesOutputAroundAnsweredPrompt(t *testing.T) {
+	session, _ := newScriptedSession("prompt>",
+		"doing real work\nmore real output\nPassword:",
+		"script output line 1\nscript output line 2\nprompt>",
+	)
+	responders := []PromptResponder{
+		{Pattern: PasswordPrompt, Response: "secret", Once: true},
+	}
+	out, err := session.RunPromptsContext(context.Background(), "run-script", responders)
+	if err != nil {
+		t.Fatalf("RunPromptsContext() error = %v", err)
+	}
+	for _, want := range []string{"doing real work", "more real output", "script output line 1", "script output line 2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("RunPromptsContext() output = %q, missing %q", out, want)
+		}
+	}
+}
+
+func TestRunPromptsContextOnceResponderAnswersOnlyOnce(t *testing.T) {
+	session, input := newScriptedSession("prompt>",
+		"Password:",
+		"Password:\nprompt>",
+	)
+	responders := []PromptResponder{
+		{Pattern: PasswordPrompt, Response: "secret", Once: true},
+	}
+	if _, err := session.RunPromptsContext(context.Background(), "run-script", responders); err != nil {
+		t.Fatalf("RunPromptsContext() error = %v", err)
+	}
+	answers := 0
+	for _, write := range input.writes {
+		if write == "secret\n" {
+			answers++
+		}
+	}
+	if answers != 1 {
+		t.Fatalf("responder answered %d times, want 1", answers)
+	}
+}
@@ -0,0 +1,62 @@
+package ssh
+
+import "sync"
+
+//ringBuffer is a fixed-capacity byte buffer that keeps only the most
+//recently written bytes once full, so draining a long-running remote
+//command no longer grows memory without bound.
+type ringBuffer struct {
+	mutex    sync.Mutex
+	data     []byte
+	capacity int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, 0, capacity), capacity: capacity}
+}
+
+//Write appends p, dropping the oldest bytes once capacity is exceeded.
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.data = append(b.data, p...)
+	if excess := len(b.data) - b.capacity; excess > 0 {
+		b.data = b.data[excess:]
+	}
+	return len(p), nil
+}
+
+//Bytes returns a copy of the buffer's current content.
+func (b *ringBuffer) Bytes() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	out := make([]byte, len(b.data))
+	copy(out, b.data)
+	return out
+}
+
+//String returns the buffer's current content.
+func (b *ringBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return string(b.data)
+}
+
+//Reset empties the buffer.
+func (b *ringBuffer) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.data = b.data[:0]
+}
+
+//Take atomically returns the buffer's current content and empties it, so a
+//concurrent Write can't land in the gap between a separate read and Reset
+//call and get silently dropped.
+func (b *ringBuffer) Take() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	out := make([]byte, len(b.data))
+	copy(out, b.data)
+	b.data = b.data[:0]
+	return out
+}
@@ -0,0 +1,44 @@
+package ssh
+
+import (
+	"testing"
+)
+
+func TestRingBufferWriteWithinCapacity(t *testing.T) {
+	buf := newRingBuffer(16)
+	if _, err := buf.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if got := buf.String(); got != "hello" {
+		t.Fatalf("String() = %q, want %q", got, "hello")
+	}
+}
+
+func TestRingBufferDropsOldestOnceOverCapacity(t *testing.T) {
+	buf := newRingBuffer(4)
+	buf.Write([]byte("abcd"))
+	buf.Write([]byte("ef"))
+	if got := buf.String(); got != "cdef" {
+		t.Fatalf("String() = %q, want %q", got, "cdef")
+	}
+}
+
+func TestRingBufferTakeEmptiesBuffer(t *testing.T) {
+	buf := newRingBuffer(16)
+	buf.Write([]byte("pending"))
+	if got := string(buf.Take()); got != "pending" {
+		t.Fatalf("Take() = %q, want %q", got, "pending")
+	}
+	if got := buf.String(); got != "" {
+		t.Fatalf("buffer not empty after Take(): %q", got)
+	}
+}
+
+func TestRingBufferReset(t *testing.T) {
+	buf := newRingBuffer(16)
+	buf.Write([]byte("stale"))
+	buf.Reset()
+	if got := buf.String(); got != "" {
+		t.Fatalf("String() after Reset() = %q, want empty", got)
+	}
+}
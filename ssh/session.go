@@ -1,11 +1,12 @@
 package ssh
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 	"io"
+	"regexp"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -15,12 +16,46 @@ const defaultShell = "/bin/bash"
 
 const defautTimeoutMs = 5000
 
+//ringBufferCapacity bounds how much undrained output drain keeps around per
+//stream before discarding the oldest bytes.
+const ringBufferCapacity = 1 << 20
+
 
 //MultiCommandSession represents a multi command session
 type MultiCommandSession interface {
 
 	Run(command string, timeoutMs int, terminators ...string) (string, error);
 
+	//RunContext is like Run but takes caller-controlled cancellation: when
+	//ctx is done, a hung remote command is interrupted (SIGINT plus a
+	//literal ^C) rather than merely abandoned.
+	RunContext(ctx context.Context, command string, terminators ...string) (string, error)
+
+	//RunWithPrompts runs command and answers any matching PromptResponder as
+	//output streams in, e.g. to automate sudo password or host-key prompts.
+	RunWithPrompts(command string, timeoutMs int, responders []PromptResponder) (string, error)
+
+	//RunPromptsContext is like RunWithPrompts but takes caller-controlled
+	//cancellation: when ctx is done, a hung remote command is interrupted
+	//(SIGINT plus a literal ^C) rather than merely abandoned.
+	RunPromptsContext(ctx context.Context, command string, responders []PromptResponder) (string, error)
+
+	//Attach bridges stdin/stdout/stderr to the remote shell, turning the
+	//session into an interactive terminal. It blocks until stdin is closed
+	//or an error occurs.
+	Attach(stdin io.Reader, stdout, stderr io.Writer) error
+
+	//Resize notifies the remote shell that the local terminal changed size,
+	//so full-screen programs (top, vim) redraw correctly.
+	Resize(rows, cols int) error
+
+	//SendSignal forwards a signal (e.g. ssh.SIGINT for Ctrl-C) to the remote process.
+	SendSignal(sig ssh.Signal) error
+
+	//SetPromptRegexp overrides the shell-prompt matcher used to detect that a
+	//command has finished, in case the auto-learned one is not specific enough.
+	SetPromptRegexp(prompt *regexp.Regexp)
+
 	ShellPrompt() string
 
 	KernelName()  string
@@ -32,24 +67,115 @@ type MultiCommandSession interface {
 //multiCommandSession represents a multi command session
 //a new command are send vi stdin
 type multiCommandSession struct {
-	session     *ssh.Session
-	stdOutput   chan string
-	stdError    chan string
-	stdInput    io.WriteCloser
-	shellPrompt string
-	kernelName  string
-	running     int32
+	session      *ssh.Session
+	stdOutBuf    *ringBuffer
+	stdErrBuf    *ringBuffer
+	stdOutNotify chan struct{}
+	stdErrNotify chan struct{}
+	stdInput     io.WriteCloser
+	shellPrompt  string
+	promptRegexp *regexp.Regexp
+	kernelName   string
+	running      int32
+	recorder     SessionRecorder
+}
+
+//Write implements io.Writer, forwarding to the remote shell's stdin and, if
+//a SessionRecorder is configured, recording the write as an input event.
+func (s *multiCommandSession) Write(p []byte) (int, error) {
+	return s.writeInput(p)
+}
+
+func (s *multiCommandSession) writeInput(p []byte) (int, error) {
+	n, err := s.stdInput.Write(p)
+	if err == nil && s.recorder != nil {
+		s.recorder.RecordInput(p[:n])
+	}
+	return n, err
 }
 
 func (s *multiCommandSession) Run(command string, timeoutMs int, terminators ...string) (string, error) {
+	if timeoutMs == 0 {
+		timeoutMs = defautTimeoutMs
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+	return s.RunContext(ctx, command, terminators...)
+}
+
+func (s *multiCommandSession) RunContext(ctx context.Context, command string, terminators ...string) (string, error) {
 	s.drainStdout()
-	_, err := s.stdInput.Write([]byte(command + "\n"))
+	_, err := s.writeInput([]byte(command + "\n"))
 	if err != nil {
 		return "", fmt.Errorf("Failed to execute command: %v, err: %v", command, err)
 	}
-	return s.readResponse(timeoutMs, terminators...)
+	return s.readResponse(ctx, terminators...)
+}
+
+
+//Attach bridges the supplied terminal streams to the remote shell so it can
+//be driven interactively, e.g. by a TUI program.
+func (s *multiCommandSession) Attach(stdin io.Reader, stdout, stderr io.Writer) error {
+	done := make(chan struct{})
+	defer close(done)
+	go s.pump(s.stdOutBuf, s.stdOutNotify, stdout, done)
+	go s.pump(s.stdErrBuf, s.stdErrNotify, stderr, done)
+	_, err := io.Copy(s, stdin)
+	return err
+}
+
+//pump forwards newly drained bytes from buf to w as they arrive, until done
+//is closed. It waits on notify, buf's own wakeup channel, rather than a
+//channel shared with the other stream's pump: sharing one channel between
+//two waiting goroutines delivers each wakeup to only one of them, so the
+//other stream's data could sit unflushed until the next unrelated write.
+func (s *multiCommandSession) pump(buf *ringBuffer, notify <-chan struct{}, w io.Writer, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-notify:
+		}
+		if data := buf.Take(); len(data) > 0 {
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+//windowChange is the SSH "window-change" request payload, see RFC 4254 6.7.
+type windowChange struct {
+	Width       uint32
+	Height      uint32
+	PixelWidth  uint32
+	PixelHeight uint32
+}
+
+//Resize issues an SSH window-change request so the remote pty picks up the
+//new terminal dimensions.
+func (s *multiCommandSession) Resize(rows, cols int) error {
+	payload := ssh.Marshal(&windowChange{
+		Width:  uint32(cols),
+		Height: uint32(rows),
+	})
+	_, err := s.session.SendRequest("window-change", false, payload)
+	return err
+}
+
+//SendSignal forwards a signal to the remote process, e.g. ssh.SIGINT for Ctrl-C.
+func (s *multiCommandSession) SendSignal(sig ssh.Signal) error {
+	return s.session.Signal(sig)
 }
 
+//SetPromptRegexp overrides the shell-prompt matcher used to detect command completion.
+func (s *multiCommandSession) SetPromptRegexp(prompt *regexp.Regexp) {
+	s.promptRegexp = prompt
+}
+
+func (s *multiCommandSession) matchesPrompt(out string) bool {
+	return s.promptRegexp != nil && s.promptRegexp.MatchString(out)
+}
 
 func (s *multiCommandSession) ShellPrompt() string {
 	return s.shellPrompt
@@ -80,13 +206,13 @@ func (s *multiCommandSession) init(shell string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	go s.drain(reader, s.stdOutput)
+	go s.drain(reader, s.stdOutBuf, s.stdOutNotify)
 
 	errReader, err := s.session.StderrPipe()
 	if err != nil {
 		return "", err
 	}
-	go s.drain(errReader, s.stdError)
+	go s.drain(errReader, s.stdErrBuf, s.stdErrNotify)
 	if shell == "" {
 		shell = defaultShell
 	}
@@ -94,39 +220,38 @@ func (s *multiCommandSession) init(shell string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return s.readResponse(defautTimeoutMs)
+	ctx, cancel := context.WithTimeout(context.Background(), defautTimeoutMs*time.Millisecond)
+	defer cancel()
+	return s.readResponse(ctx)
 }
 
-func (s *multiCommandSession) drain(reader io.Reader, out chan string) {
-	var written int64 = 0
-	buf := make([]byte, 128*1024)
+func (s *multiCommandSession) drain(reader io.Reader, buf *ringBuffer, notify chan<- struct{}) {
+	chunk := make([]byte, 128*1024)
 	for {
-		writter := new(bytes.Buffer)
 		if atomic.LoadInt32(&s.running) == 0 {
 			return
 		}
-
-		bytesRead, readError := reader.Read(buf)
+		bytesRead, readError := reader.Read(chunk)
 		if bytesRead > 0 {
-			bytesWritten, writeError := writter.Write(buf[:bytesRead])
-			if s.closeIfError(writeError) {
-				return
+			buf.Write(chunk[:bytesRead])
+			if s.recorder != nil {
+				s.recorder.RecordOutput(chunk[:bytesRead])
 			}
-			if bytesWritten > 0 {
-				written += int64(bytesWritten)
-			}
-
-			if bytesRead != bytesWritten {
-				if s.closeIfError(io.ErrShortWrite) {
-					return
-				}
-			}
-			out <- string(writter.Bytes())
+			signalOutput(notify)
 		}
 		if s.closeIfError(readError) {
 			return
 		}
+	}
+}
 
+//signalOutput wakes up any reader blocked waiting for new output on notify,
+//without blocking drain if nobody is currently waiting. Each stream has its
+//own notify channel so one stream's wakeups can never starve the other's.
+func signalOutput(notify chan<- struct{}) {
+	select {
+	case notify <- struct{}{}:
+	default:
 	}
 }
 
@@ -142,65 +267,108 @@ func hasTerminator(source string, terminators ...string) bool {
 			return true
 		} else if strings.Contains(source, candidate) {
 			return true
+		} else if re, compileErr := regexp.Compile(candidate); compileErr == nil && re.MatchString(source) {
+			return true
 		}
 	}
 	return false
 }
 
 
-func (s *multiCommandSession) readResponse(timeoutMs int, terminators ...string) (out string, err error) {
-	if timeoutMs == 0 {
-		timeoutMs = defautTimeoutMs
-	}
+//terminatorWindow bounds how much of the trailing output readResponse
+//re-scans for a terminator/prompt match on each wakeup. It must be at
+//least as large as any terminator or shell prompt readResponse is asked
+//to match; matches never span further back than this into history.
+const terminatorWindow = 4096
+
+func (s *multiCommandSession) readResponse(ctx context.Context, terminators ...string) (out string, err error) {
 	if len(terminators) == 0 {
-		if s.shellPrompt == "" {
+		if s.shellPrompt != "" {
 			terminators = []string{s.shellPrompt + "$"}
 		} else {
+			//no prompt learned yet: fall back to the generic "$ " shell prompt
+			//suffix rather than a bare "$", which would make hasTerminator's
+			//suffix check degenerate into HasSuffix(x, "") and match anything,
+			//including an empty, not-yet-read response.
 			terminators = []string{"$ $"}
 		}
 	}
-	var done int32
-	defer atomic.StoreInt32(&done, 1)
-	var errOut string
+	//out/errOut accumulate the full response via strings.Builder (amortized
+	//O(1) append) rather than out += string(chunk), which would re-copy the
+	//whole accumulated string on every wakeup and turn a multi-MB response
+	//into an O(n^2) drain. outTail/errTail mirror only the trailing
+	//terminatorWindow bytes so hasTerminator/matchesPrompt re-scan a bounded
+	//window instead of the ever-growing accumulation.
+	var outBuilder, errBuilder strings.Builder
+	var outTail, errTail string
 outer:
 	for {
-		select {
-
-		case o := <-s.stdOutput:
-			out += o
-			if hasTerminator(out, terminators...) && len(s.stdOutput) == 0 {
+		gotData := false
+		if chunk := s.stdOutBuf.Take(); len(chunk) > 0 {
+			gotData = true
+			outBuilder.Write(chunk)
+			outTail = tailWindow(outTail+string(chunk), terminatorWindow)
+		}
+		if chunk := s.stdErrBuf.Take(); len(chunk) > 0 {
+			gotData = true
+			errBuilder.Write(chunk)
+			errTail = tailWindow(errTail+string(chunk), terminatorWindow)
+		}
+		//only re-scan for a terminator once this pass actually consumed new
+		//bytes: checking unconditionally would match a terminator against
+		//still-empty outTail/errTail before the remote ever wrote anything.
+		if gotData {
+			if hasTerminator(outTail, terminators...) || s.matchesPrompt(outTail) {
 				break outer
 			}
-		case e := <-s.stdError:
-			errOut += e
-			if hasTerminator(errOut, terminators...) && len(s.stdOutput) == 0 {
+			if errTail != "" && (hasTerminator(errTail, terminators...) || s.matchesPrompt(errTail)) {
 				break outer
 			}
-
-		case <-time.After(time.Duration(timeoutMs) * time.Millisecond):
+		}
+		select {
+		case <-s.stdOutNotify:
+		case <-s.stdErrNotify:
+		case <-ctx.Done():
+			//the remote command is still running but we've given up waiting on
+			//it: actually interrupt it instead of just abandoning the session
+			//with output still draining into buffers.
+			s.session.Signal(ssh.SIGINT)
+			s.writeInput([]byte{0x03})
 			break outer
 		}
 	}
+	out = outBuilder.String()
+	errOut := errBuilder.String()
 	if errOut != "" {
 		err = errors.New(errOut)
 	}
+	out = s.trimPrompt(out)
+	return out, err
+}
+
+//tailWindow returns the last max bytes of s, so callers can re-check a
+//bounded suffix for a terminator match instead of the whole accumulated
+//string.
+func tailWindow(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[len(s)-max:]
+}
+
+func (s *multiCommandSession) trimPrompt(out string) string {
 	if len(out) > 0 {
 		index := strings.LastIndex(out, "\r\n"+s.shellPrompt)
 		if index > 0 {
-			out = string(out[:index])
+			out = out[:index]
 		}
 	}
-	return out, err
+	return out
 }
 
 func (s *multiCommandSession) drainStdout() {
-	//read any outstanding output
-	for ; ; {
-		out, _ := s.readResponse(1, "")
-		if len(out) == 0 {
-			return
-		}
-	}
+	s.stdOutBuf.Reset()
+	s.stdErrBuf.Reset()
 }
 
 
@@ -240,13 +408,23 @@ func newMultiCommandSession(client *ssh.Client, config *SessionConfig) (MultiCom
 		return nil, err
 	}
 	result := &multiCommandSession{
-		session:   session,
-		stdOutput: make(chan string),
-		stdError:  make(chan string),
-		stdInput:  writer,
-		running:   1,
+		session:      session,
+		stdOutBuf:    newRingBuffer(ringBufferCapacity),
+		stdErrBuf:    newRingBuffer(ringBufferCapacity),
+		stdOutNotify: make(chan struct{}, 1),
+		stdErrNotify: make(chan struct{}, 1),
+		stdInput:     writer,
+		running:      1,
+		recorder:     config.Recorder,
 	}
-	_, err = result.init(config.Shell)
+	shell := config.Shell
+	if shell == "" {
+		shell = defaultShell
+	}
+	if starter, ok := result.recorder.(recorderStarter); ok {
+		starter.Start(config.Columns, config.Rows, config.Term, shell)
+	}
+	_, err = result.init(shell)
 	if result.closeIfError(err) {
 		return nil, err
 	}
@@ -254,6 +432,9 @@ func newMultiCommandSession(client *ssh.Client, config *SessionConfig) (MultiCom
 	if result.closeIfError(err) {
 		return nil, err
 	}
+	if result.shellPrompt != "" {
+		result.SetPromptRegexp(regexp.MustCompile(regexp.QuoteMeta(result.shellPrompt) + `\s*$`))
+	}
 	result.drainStdout()
 	result.kernelName, err = result.Run("uname -s", 20000, "Linux", "Darwin", "$", "#")
 	result.drainStdout()
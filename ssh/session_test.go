@@ -0,0 +1,77 @@
+package ssh
+
+import "testing"
+
+func TestHasTerminator(t *testing.T) {
+	testCases := []struct {
+		description string
+		source      string
+		terminators []string
+		expect      bool
+	}{
+		{
+			description: "plain substring match",
+			source:      "some output\n$ ",
+			terminators: []string{"$ "},
+			expect:      true,
+		},
+		{
+			description: "anchored prefix (^) match",
+			source:      "root@host:~$ ",
+			terminators: []string{"^root@host"},
+			expect:      true,
+		},
+		{
+			description: "anchored suffix ($) match",
+			source:      "uname -s\nLinux",
+			terminators: []string{"Linux$"},
+			expect:      true,
+		},
+		{
+			description: "regexp match",
+			source:      "exit status 0",
+			terminators: []string{`exit status \d+`},
+			expect:      true,
+		},
+		{
+			description: "no match",
+			source:      "still running",
+			terminators: []string{"$ $", "done"},
+			expect:      false,
+		},
+	}
+	for _, testCase := range testCases {
+		actual := hasTerminator(testCase.source, testCase.terminators...)
+		if actual != testCase.expect {
+			t.Errorf("%v: hasTerminator() = %v, want %v", testCase.description, actual, testCase.expect)
+		}
+	}
+}
+
+func TestTailWindow(t *testing.T) {
+	testCases := []struct {
+		description string
+		source      string
+		max         int
+		expect      string
+	}{
+		{
+			description: "shorter than window returned unchanged",
+			source:      "abc",
+			max:         8,
+			expect:      "abc",
+		},
+		{
+			description: "longer than window truncated to trailing bytes",
+			source:      "abcdefgh",
+			max:         3,
+			expect:      "fgh",
+		},
+	}
+	for _, testCase := range testCases {
+		actual := tailWindow(testCase.source, testCase.max)
+		if actual != testCase.expect {
+			t.Errorf("%v: tailWindow() = %q, want %q", testCase.description, actual, testCase.expect)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"os"
+)
+
+//FileTransfer provides SFTP-backed file transfer on top of an existing SSH
+//connection, so a single *ssh.Client can multiplex command sessions and
+//file transfer.
+type FileTransfer interface {
+
+	Upload(localPath, remotePath string, mode os.FileMode) error
+
+	Download(remotePath, localPath string) error
+
+	Walk(root string, fn func(path string, info os.FileInfo) error) error
+
+	Mkdirs(remotePath string) error
+
+	Close() error
+}
+
+//fileTransfer represents an SFTP backed file transfer
+type fileTransfer struct {
+	session *ssh.Session
+	client  *sftp.Client
+}
+
+//Upload copies localPath to remotePath on the remote host and sets its mode.
+func (f *fileTransfer) Upload(localPath, remotePath string, mode os.FileMode) error {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	remote, err := f.client.Create(remotePath)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	if _, err = remote.ReadFrom(local); err != nil {
+		return err
+	}
+	return f.client.Chmod(remotePath, mode)
+}
+
+//Download copies remotePath on the remote host to localPath.
+func (f *fileTransfer) Download(remotePath, localPath string) error {
+	remote, err := f.client.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	local, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	_, err = remote.WriteTo(local)
+	return err
+}
+
+//Walk visits every file and directory under the remote root, calling fn with
+//its path and os.FileInfo.
+func (f *fileTransfer) Walk(root string, fn func(path string, info os.FileInfo) error) error {
+	walker := f.client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		if err := fn(walker.Path(), walker.Stat()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Mkdirs creates remotePath and any missing parent directories.
+func (f *fileTransfer) Mkdirs(remotePath string) error {
+	return f.client.MkdirAll(remotePath)
+}
+
+//Close releases the SFTP client and its underlying SSH session.
+func (f *fileTransfer) Close() error {
+	if err := f.client.Close(); err != nil {
+		f.session.Close()
+		return err
+	}
+	return f.session.Close()
+}
+
+//OpenSFTP opens an SFTP subsystem session on client, reusing its existing
+//auth, host-key callback and transport, so it can be used alongside a
+//MultiCommandSession created from the same *ssh.Client. If config is
+//non-nil, its EnvVariables are set on the session before the SFTP
+//subsystem is requested, the same way newMultiCommandSession does for
+//command sessions.
+func OpenSFTP(client *ssh.Client, config *SessionConfig) (FileTransfer, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		for k, v := range config.EnvVariables {
+			if err = session.Setenv(k, v); err != nil {
+				session.Close()
+				return nil, err
+			}
+		}
+	}
+	pipeIn, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	pipeOut, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err = session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, err
+	}
+	sftpClient, err := sftp.NewClientPipe(pipeOut, pipeIn)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &fileTransfer{session: session, client: sftpClient}, nil
+}